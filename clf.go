@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logFormat selects how a line of the access log is tokenized.
+type logFormat int
+
+const (
+	logFormatAuto logFormat = iota
+	logFormatJSON
+	logFormatCLF
+)
+
+// parseLogFormat parses the --format flag value.
+func parseLogFormat(s string) (logFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return logFormatAuto, nil
+	case "json":
+		return logFormatJSON, nil
+	case "clf", "common":
+		return logFormatCLF, nil
+	default:
+		return logFormatAuto, fmt.Errorf("unknown format %q, expected auto, json, or clf", s)
+	}
+}
+
+// detectLogFormat sniffs a single line to tell Traefik's JSON format from
+// its CLF (common) format.
+func detectLogFormat(line []byte) logFormat {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed) {
+		return logFormatJSON
+	}
+	return logFormatCLF
+}
+
+// decodeLine decodes one access-log line, already resolved to a concrete
+// format, into the canonical logEntry shape.
+func decodeLine(line []byte, format logFormat, version traefikVersion) (logEntry, error) {
+	if format == logFormatCLF {
+		return parseCLFLine(string(line))
+	}
+	if !json.Valid(line) {
+		return logEntry{}, fmt.Errorf("line contains invalid json: %q", line)
+	}
+	return decodeLogLine(line, version)
+}
+
+// clfLineRegexp matches the extended Common Log Format line Traefik's
+// "common" access log middleware emits:
+//
+//	ClientHost - ClientUsername [StartUTC] "RequestMethod RequestPath RequestProtocol" DownstreamStatus DownstreamContentSize "Referer" "User-Agent" RequestCount "FrontendName" "BackendURL" Duration
+//
+// Duration is Go's default time.Duration string representation (e.g. "1ms",
+// "956µs", "2.5s"), not a bare integer.
+var clfLineRegexp = regexp.MustCompile(
+	`^(\S+) - (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d+) (\d+) "([^"]*)" "([^"]*)" (\d+) "([^"]*)" "([^"]*)" (\S+)$`)
+
+// parseCLFLine tokenizes one Traefik CLF access-log line into the same
+// canonical logEntry shape the JSON parser produces.
+func parseCLFLine(line string) (logEntry, error) {
+	m := clfLineRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return logEntry{}, fmt.Errorf("line does not match the traefik CLF format: %q", line)
+	}
+
+	downstreamStatus, err := strconv.Atoi(m[7])
+	if err != nil {
+		return logEntry{}, fmt.Errorf("invalid DownstreamStatus %q: %q", m[7], err)
+	}
+	downstreamContentSize, err := strconv.Atoi(m[8])
+	if err != nil {
+		return logEntry{}, fmt.Errorf("invalid DownstreamContentSize %q: %q", m[8], err)
+	}
+	requestCount, err := strconv.Atoi(m[11])
+	if err != nil {
+		return logEntry{}, fmt.Errorf("invalid RequestCount %q: %q", m[11], err)
+	}
+	duration, err := time.ParseDuration(m[14])
+	if err != nil {
+		return logEntry{}, fmt.Errorf("invalid Duration %q: %q", m[14], err)
+	}
+
+	return logEntry{
+		ClientHost:            m[1],
+		ClientUsername:        m[2],
+		StartUTC:              m[3],
+		RequestMethod:         m[4],
+		RequestPath:           m[5],
+		RequestProtocol:       m[6],
+		DownstreamStatus:      downstreamStatus,
+		DownstreamContentSize: downstreamContentSize,
+		RequestReferer:        m[9],
+		RequestUserAgent:      m[10],
+		RequestCount:          requestCount,
+		FrontendName:          m[12],
+		BackendURL:            parseBackendURL(m[13]),
+		Duration:              int(duration.Nanoseconds()),
+	}, nil
+}
+
+// parseBackendURL best-effort parses the CLF BackendURL token into the same
+// backendTraefik shape the JSON parser gets for free from Go's url.URL.
+func parseBackendURL(raw string) backendTraefik {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return backendTraefik{}
+	}
+	return backendTraefik{
+		Scheme:     u.Scheme,
+		Opaque:     u.Opaque,
+		User:       u.User.String(),
+		Host:       u.Host,
+		Path:       u.Path,
+		RawPath:    u.RawPath,
+		ForceQuery: strconv.FormatBool(u.ForceQuery),
+		RawQuery:   u.RawQuery,
+		Fragment:   u.Fragment,
+	}
+}
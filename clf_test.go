@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseCLFLine(t *testing.T) {
+	// A real line in the shape Traefik's common access log middleware emits,
+	// with a unit-suffixed Duration rather than a bare integer.
+	line := `10.0.0.1 - - [10/Jun/2025:09:00:00 +0000] "GET /api HTTP/1.1" 200 12 "-" "curl/8.4.0" 1 "web-router@docker" "http://172.21.0.3:80" 1ms`
+
+	entry, err := parseCLFLine(line)
+	if err != nil {
+		t.Fatalf("parseCLFLine returned error: %v", err)
+	}
+	if entry.ClientHost != "10.0.0.1" {
+		t.Errorf("ClientHost = %q, want %q", entry.ClientHost, "10.0.0.1")
+	}
+	if entry.DownstreamStatus != 200 {
+		t.Errorf("DownstreamStatus = %d, want 200", entry.DownstreamStatus)
+	}
+	if entry.FrontendName != "web-router@docker" {
+		t.Errorf("FrontendName = %q, want %q", entry.FrontendName, "web-router@docker")
+	}
+	if entry.Duration != int(time.Millisecond.Nanoseconds()) {
+		t.Errorf("Duration = %d, want %d (1ms in nanoseconds)", entry.Duration, time.Millisecond.Nanoseconds())
+	}
+}
+
+func TestParseCLFLineDurationUnits(t *testing.T) {
+	const lineFmt = `10.0.0.1 - - [10/Jun/2025:09:00:00 +0000] "GET / HTTP/1.1" 200 0 "-" "-" 1 "r@docker" "http://b:80" %s`
+	cases := []struct {
+		raw  string
+		want time.Duration
+	}{
+		{"1ms", time.Millisecond},
+		{"956µs", 956 * time.Microsecond},
+		{"2.5s", 2500 * time.Millisecond},
+	}
+	for _, c := range cases {
+		entry, err := parseCLFLine(fmt.Sprintf(lineFmt, c.raw))
+		if err != nil {
+			t.Fatalf("parseCLFLine(%q) returned error: %v", c.raw, err)
+		}
+		if entry.Duration != int(c.want.Nanoseconds()) {
+			t.Errorf("Duration for %q = %d, want %d", c.raw, entry.Duration, c.want.Nanoseconds())
+		}
+	}
+}
+
+func TestDetectLogFormat(t *testing.T) {
+	clfLine := `10.0.0.1 - - [10/Jun/2025:09:00:00 +0000] "GET / HTTP/1.1" 200 0 "-" "-" 1 "r@docker" "http://b:80" 1ms`
+	if got := detectLogFormat([]byte(`{"level":"info","msg":"test"}`)); got != logFormatJSON {
+		t.Errorf("detectLogFormat(json) = %v, want logFormatJSON", got)
+	}
+	if got := detectLogFormat([]byte(clfLine)); got != logFormatCLF {
+		t.Errorf("detectLogFormat(clf) = %v, want logFormatCLF", got)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// pollInterval is how often runFollow checks for new data once it has
+// caught up to EOF.
+const pollInterval = 1 * time.Second
+
+const createCheckpointTableSQL = `CREATE TABLE IF NOT EXISTS ingest_checkpoint (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	file_path TEXT NOT NULL,
+	offset INTEGER NOT NULL,
+	inode INTEGER NOT NULL
+)`
+
+type checkpoint struct {
+	Offset int64
+	Inode  uint64
+}
+
+func ensureCheckpointTable(db *sql.DB) error {
+	_, err := db.Exec(createCheckpointTableSQL)
+	return err
+}
+
+// loadCheckpoint returns the last persisted checkpoint for logPath, or the
+// zero checkpoint if none has been saved yet (or it was saved for a
+// different file).
+func loadCheckpoint(db *sql.DB, logPath string) (checkpoint, error) {
+	var cp checkpoint
+	var path string
+	row := db.QueryRow(`SELECT file_path, offset, inode FROM ingest_checkpoint WHERE id = 1`)
+	if err := row.Scan(&path, &cp.Offset, &cp.Inode); err != nil {
+		if err == sql.ErrNoRows {
+			return checkpoint{}, nil
+		}
+		return checkpoint{}, err
+	}
+	if path != logPath {
+		return checkpoint{}, nil
+	}
+	return cp, nil
+}
+
+func saveCheckpointTx(tx *sql.Tx, logPath string, cp checkpoint) error {
+	_, err := tx.Exec(`INSERT INTO ingest_checkpoint (id, file_path, offset, inode) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET file_path = excluded.file_path, offset = excluded.offset, inode = excluded.inode`,
+		logPath, cp.Offset, cp.Inode)
+	return err
+}
+
+func fileInode(info os.FileInfo) (uint64, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("unable to determine inode for %s", info.Name())
+	}
+	return stat.Ino, nil
+}
+
+// openAtCheckpoint opens logPath and seeks to the resume position described
+// by cp, falling back to the start of the file if the inode has changed
+// (rotation) or the file has shrunk (truncation).
+func openAtCheckpoint(logPath string, cp checkpoint) (*os.File, checkpoint, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, checkpoint{}, fmt.Errorf("unable to open traefik log file %s: %q", logPath, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, checkpoint{}, fmt.Errorf("unable to stat %s: %q", logPath, err)
+	}
+	inode, err := fileInode(info)
+	if err != nil {
+		f.Close()
+		return nil, checkpoint{}, err
+	}
+
+	resume := cp
+	if cp.Inode != inode || info.Size() < cp.Offset {
+		resume = checkpoint{Offset: 0, Inode: inode}
+	} else {
+		resume.Inode = inode
+	}
+	if _, err := f.Seek(resume.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, checkpoint{}, fmt.Errorf("unable to seek %s to offset %d: %q", logPath, resume.Offset, err)
+	}
+	return f, resume, nil
+}
+
+// rotated reports whether logPath now refers to a different inode than cur,
+// or has been truncated below the current read position.
+func rotated(logPath string, cur *os.File, currentOffset int64) (bool, error) {
+	newInfo, err := os.Stat(logPath)
+	if err != nil {
+		return false, err
+	}
+	curInfo, err := cur.Stat()
+	if err != nil {
+		return false, err
+	}
+	newIno, err := fileInode(newInfo)
+	if err != nil {
+		return false, err
+	}
+	curIno, err := fileInode(curInfo)
+	if err != nil {
+		return false, err
+	}
+	if newIno != curIno {
+		return true, nil
+	}
+	if newInfo.Size() < currentOffset {
+		return true, nil
+	}
+	return false, nil
+}
+
+// flushBatch writes entries and the resulting checkpoint in a single
+// transaction, with the insert statement prepared once for the whole batch.
+func flushBatch(db *sql.DB, entries []logEntry, logPath string, cp checkpoint) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %q", err)
+	}
+	stmt, err := tx.Prepare(buildInsertSQL())
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to prepare SQL statement: %q", err)
+	}
+	headerStmt, err := tx.Prepare(insertHeaderSQL)
+	if err != nil {
+		stmt.Close()
+		tx.Rollback()
+		return fmt.Errorf("unable to prepare header SQL statement: %q", err)
+	}
+	for _, log := range entries {
+		res, err := stmt.Exec(columnValues(log)...)
+		if err != nil {
+			stmt.Close()
+			headerStmt.Close()
+			tx.Rollback()
+			return fmt.Errorf("unable to insert log line: %q", err)
+		}
+		logID, err := res.LastInsertId()
+		if err != nil {
+			stmt.Close()
+			headerStmt.Close()
+			tx.Rollback()
+			return fmt.Errorf("unable to read inserted log id: %q", err)
+		}
+		for _, h := range headerRows(log) {
+			if _, err := headerStmt.Exec(logID, h.name, h.value); err != nil {
+				stmt.Close()
+				headerStmt.Close()
+				tx.Rollback()
+				return fmt.Errorf("unable to insert header %s: %q", h.name, err)
+			}
+		}
+	}
+	stmt.Close()
+	headerStmt.Close()
+	if err := saveCheckpointTx(tx, logPath, cp); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to save checkpoint: %q", err)
+	}
+	return tx.Commit()
+}
+
+// runFollow tails logFile continuously, batching parsed lines into
+// transactional inserts against sql_db and persisting a byte-offset
+// checkpoint so a restart resumes without dropping or duplicating lines.
+func runFollow(logPath, dbPath string, batchSize int, flushInterval time.Duration, format logFormat, version traefikVersion) error {
+	db, err := openSQLiteDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("unable to open sqlite database: %q", err)
+	}
+	defer db.Close()
+
+	if err := ensureAccessLogsTable(db); err != nil {
+		return fmt.Errorf("unable to prepare access_logs table: %q", err)
+	}
+	if err := ensureCheckpointTable(db); err != nil {
+		return fmt.Errorf("unable to prepare checkpoint table: %q", err)
+	}
+
+	startCp, err := loadCheckpoint(db, logPath)
+	if err != nil {
+		return fmt.Errorf("unable to load checkpoint: %q", err)
+	}
+	f, cp, err := openAtCheckpoint(logPath, startCp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var pending bytes.Buffer // bytes read past the last complete line
+	var batch []logEntry
+	var pendingBytes int64
+	resolved := format
+	readBuf := make([]byte, 64*1024)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		next := cp
+		next.Offset += pendingBytes
+		if err := flushBatch(db, batch, logPath, next); err != nil {
+			return err
+		}
+		cp = next
+		batch = batch[:0]
+		pendingBytes = 0
+		return nil
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		default:
+		}
+
+		n, err := f.Read(readBuf)
+		if n > 0 {
+			pending.Write(readBuf[:n])
+			for {
+				chunk := pending.Bytes()
+				idx := bytes.IndexByte(chunk, '\n')
+				if idx < 0 {
+					break
+				}
+				line := append([]byte(nil), chunk[:idx+1]...)
+				pending.Next(idx + 1)
+
+				lineOffset := cp.Offset + pendingBytes
+				trimmed := bytes.TrimSpace(line)
+				if resolved == logFormatAuto && len(trimmed) > 0 {
+					resolved = detectLogFormat(trimmed)
+				}
+				if entry, decodeErr := decodeLine(trimmed, resolved, version); decodeErr == nil {
+					batch = append(batch, entry)
+				} else {
+					fmt.Fprintf(os.Stderr, "skipping unparseable line at offset %d: %q\n", lineOffset, decodeErr)
+				}
+				pendingBytes += int64(len(line))
+			}
+			if len(batch) >= batchSize {
+				if flushErr := flush(); flushErr != nil {
+					return flushErr
+				}
+			}
+		}
+		if err != nil {
+			didRotate, rotErr := rotated(logPath, f, cp.Offset+pendingBytes)
+			if rotErr != nil {
+				return fmt.Errorf("unable to check for log rotation: %q", rotErr)
+			}
+			if flushErr := flush(); flushErr != nil {
+				return flushErr
+			}
+			if didRotate {
+				f.Close()
+				var openErr error
+				f, cp, openErr = openAtCheckpoint(logPath, checkpoint{})
+				if openErr != nil {
+					return openErr
+				}
+				pending.Reset()
+				pendingBytes = 0
+				continue
+			}
+			time.Sleep(pollInterval)
+			continue
+		}
+	}
+}
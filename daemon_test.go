@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenAtCheckpointResumesFromOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("line one\nline two\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	inode, err := fileInode(info)
+	if err != nil {
+		t.Fatalf("fileInode: %v", err)
+	}
+
+	f, cp, err := openAtCheckpoint(path, checkpoint{Offset: 9, Inode: inode})
+	if err != nil {
+		t.Fatalf("openAtCheckpoint: %v", err)
+	}
+	defer f.Close()
+	if cp.Offset != 9 {
+		t.Errorf("Offset = %d, want 9", cp.Offset)
+	}
+	buf := make([]byte, 8)
+	n, _ := f.Read(buf)
+	if string(buf[:n]) != "line two" {
+		t.Errorf("resumed read = %q, want %q", buf[:n], "line two")
+	}
+}
+
+func TestOpenAtCheckpointResetsOnInodeChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("fresh content\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	_, cp, err := openAtCheckpoint(path, checkpoint{Offset: 100, Inode: 999999})
+	if err != nil {
+		t.Fatalf("openAtCheckpoint: %v", err)
+	}
+	if cp.Offset != 0 {
+		t.Errorf("Offset = %d, want 0 after an inode mismatch (rotation)", cp.Offset)
+	}
+}
+
+func TestRotatedDetectsNewInode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("a\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("b\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	didRotate, err := rotated(path, f, 1)
+	if err != nil {
+		t.Fatalf("rotated: %v", err)
+	}
+	if !didRotate {
+		t.Error("rotated = false, want true after the inode changed")
+	}
+}
@@ -2,20 +2,34 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
-	"encoding/json"
 	"flag"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"net/http"
 	"os"
+	"time"
 )
 
 var (
-	logFile  = flag.String("log_file", "", "Path to the traefik log file.")
-	sql_db   = flag.String("sql_db", "", "Path to the sqlite database.")
-	truncate = flag.Bool("truncate", false, "Truncate the log file after reading.")
+	logFile       = flag.String("log_file", "", "Path to the traefik log file.")
+	sql_db        = flag.String("sql_db", "", "Path to the sqlite database, or the DSN for --sink=mysql/postgres.")
+	truncate      = flag.Bool("truncate", false, "Truncate the log file after reading.")
+	follow        = flag.Bool("follow", false, "Tail the log file continuously instead of a single pass, resuming from a saved checkpoint.")
+	batchSize     = flag.Int("batch_size", 500, "Number of log lines to batch per insert transaction in --follow mode.")
+	flushInterval = flag.Duration("flush_interval", 5*time.Second, "Maximum time to hold a partial batch before flushing it in --follow mode.")
+	sinkKind      = flag.String("sink", "sqlite", "Output sink for parsed logs: sqlite, mysql, postgres, or stdout. Only sqlite gets the full auto-migrating schema with header capture; mysql and postgres use a fixed, pre-chunk0-3 column set with no access_log_headers and no v2-only columns (RequestScheme/TLSVersion/TLSCipher).")
+	httpAddr      = flag.String("http_addr", "", "Address to serve the access_logs query API on, e.g. :8080. Disabled if empty.")
+	apiToken      = flag.String("api_token", "", "Shared token required on HTTP API requests via 'Authorization: Bearer <token>'. Required when --http_addr is set.")
+	traefikVer    = flag.String("traefik_version", "auto", "Traefik JSON access-log shape to expect: auto, v1, or v2.")
+	logFormatFlag = flag.String("format", "auto", "Access log line format: auto, json, or clf.")
 )
 
+// logEntry is the canonical, version-independent shape every parsed access
+// log line is normalized into (see parser.go). BackendName/FrontendName
+// carry Traefik v2's ServiceName/RouterName when the source log is v2;
+// RequestScheme/TLSVersion/TLSCipher are v2-only and left empty for v1.
 type logEntry struct {
 	BackendAddr                     int            `json:"BackendAddr"`
 	BackendName                     string         `json:"BackendName"`
@@ -43,9 +57,12 @@ type logEntry struct {
 	RequestPath                     string         `json:"RequestPath"`
 	RequestPort                     string         `json:"RequestPort"`
 	RequestProtocol                 string         `json:"RequestProtocol"`
+	RequestScheme                   string         `json:"RequestScheme"`
 	RetryAttempts                   int            `json:"RetryAttempts"`
 	StartLocal                      string         `json:"StartLocal"`
 	StartUTC                        string         `json:"StartUTC"`
+	TLSVersion                      string         `json:"TLSVersion"`
+	TLSCipher                       string         `json:"TLSCipher"`
 	DownstreamContentType           string         `json:"downstream_Content-Type"`
 	DownstreamDate                  string         `json:"downstream_Date"`
 	Level                           string         `json:"level"`
@@ -75,25 +92,28 @@ type backendTraefik struct {
 	Fragment   string `json:"Fragment"`
 }
 
-func parseAccessLog(accessLog string, truncate bool) ([]logEntry, error) {
-	// Open the json file
+func parseAccessLog(accessLog string, truncate bool, format logFormat, version traefikVersion) ([]logEntry, error) {
+	// Open the log file
 	jsonFile, err := os.Open(accessLog)
 	if err != nil {
 		return []logEntry{}, fmt.Errorf("unable to open traefik log file %s: %q", accessLog, err)
 	}
 	defer jsonFile.Close()
 
-	// Iterate over the file, decode each line as json
-	// since it's technically not in a list.
+	// Iterate over the file, decoding each line on its own since it's
+	// technically not a single JSON (or CLF) document.
 	scanner := bufio.NewScanner(jsonFile)
 	var logs []logEntry
-	for scanner.Scan() {
-		logBytes := scanner.Bytes()
-		if !json.Valid(logBytes) {
-			return []logEntry{}, fmt.Errorf("line contains invalid json: %q", logBytes)
+	resolved := format
+	for i := 0; scanner.Scan(); i++ {
+		lineBytes := scanner.Bytes()
+		if i == 0 && format == logFormatAuto {
+			resolved = detectLogFormat(lineBytes)
+		}
+		logLine, err := decodeLine(lineBytes, resolved, version)
+		if err != nil {
+			return []logEntry{}, fmt.Errorf("unable to decode log line: %q", err)
 		}
-		var logLine logEntry
-		json.Unmarshal(logBytes, &logLine)
 		logs = append(logs, logLine)
 	}
 	if truncate {
@@ -103,36 +123,11 @@ func parseAccessLog(accessLog string, truncate bool) ([]logEntry, error) {
 	return logs, err
 }
 
-func insertLogs(logs []logEntry, db_path string) error {
-	db, err := sql.Open("sqlite3", db_path)
-	defer db.Close()
-	if err != nil {
-		return fmt.Errorf("unable to open sqlite database: %q", err)
-	}
-	stmt, err := db.Prepare(`CREATE TABLE IF NOT EXISTS access_logs (id INTEGER PRIMARY KEY, BackendName TEXT, BackendURLScheme TEXT, 
-	BackendURLHost TEXT, ClientAddr TEXT, ClientHost TEXT, ClientPort TEXT, ClientUsername TEXT, DownstreamStatus INTEGER, DownstreamContentSize INTEGER,
-	Duration INTEGER, FrontendName TEXT, OriginContentSize INTEGER, OriginDuration INTEGER, RequestAddr TEXT, RequestContentSize INTEGER, 
-	RequestCount INTEGER, RequestHost TEXT, RequestMethod TEXT, RequestPath TEXT, RequestPort TEXT, RequestProtocol TEXT, StartUTC TEXT, RequestReferer TEXT,
-	RequestUserAgent TEXT, Time TEXT)`)
-	if err != nil {
-		return fmt.Errorf("unable to prepare SQL statement: %q", err)
-	}
-	stmt.Exec()
-
-	for _, log := range logs {
-		stmt, err := db.Prepare(`INSERT INTO access_logs (BackendName, BackendURLScheme, BackendURLHost, ClientAddr, ClientHost, ClientPort,
-		ClientUsername, DownstreamStatus, DownstreamContentSize, Duration, FrontendName, OriginContentSize, OriginDuration, RequestAddr, RequestContentSize,
-		RequestCount, RequestHost, RequestMethod, RequestPath, RequestPort, RequestProtocol, StartUTC, RequestReferer, RequestUserAgent, Time) VALUES
-		(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-		if err != nil {
-			return fmt.Errorf("unable to prepare SQL statement: %q", err)
-		}
-		stmt.Exec(log.BackendName, log.BackendURL.Scheme, log.BackendURL.Host, log.ClientAddr, log.ClientHost, log.ClientPort, log.ClientUsername,
-			log.DownstreamStatus, log.DownstreamContentSize, log.Duration, log.FrontendName, log.OriginContentSize, log.OriginDuration, log.RequestAddr,
-			log.RequestContentSize, log.RequestCount, log.RequestHost, log.RequestMethod, log.RequestPath, log.RequestPort, log.RequestProtocol, log.StartUTC,
-			log.RequestReferer, log.RequestUserAgent, log.Time)
-	}
-	return nil
+// ensureAccessLogsTable brings the sqlite schema up to date: the full
+// access_logs column set and the access_log_headers side table are derived
+// from logEntry and kept in sync by runMigrations (see migrate.go).
+func ensureAccessLogsTable(db *sql.DB) error {
+	return runMigrations(db)
 }
 
 func main() {
@@ -143,22 +138,77 @@ func main() {
 		fmt.Printf("No log file specified, exiting.\n")
 		os.Exit(1)
 	}
-	if *sql_db == "" {
+	if *sql_db == "" && *sinkKind != "stdout" {
 		fmt.Printf("No sql DB specified, exiting.\n")
 		os.Exit(1)
 	}
+	version, err := parseTraefikVersion(*traefikVer)
+	if err != nil {
+		fmt.Printf("%q\n", err)
+		os.Exit(1)
+	}
+	format, err := parseLogFormat(*logFormatFlag)
+	if err != nil {
+		fmt.Printf("%q\n", err)
+		os.Exit(1)
+	}
+
+	if *follow && !isSQLiteSink(*sinkKind) {
+		fmt.Printf("--follow only supports --sink=sqlite, got %q, exiting.\n", *sinkKind)
+		os.Exit(1)
+	}
+
+	if *httpAddr != "" {
+		if !isSQLiteSink(*sinkKind) {
+			fmt.Printf("--http_addr only supports --sink=sqlite, got %q, exiting.\n", *sinkKind)
+			os.Exit(1)
+		}
+		if *apiToken == "" {
+			fmt.Printf("--api_token is required when --http_addr is set, exiting.\n")
+			os.Exit(1)
+		}
+		apiDB, err := openSQLiteDB(*sql_db)
+		if err != nil {
+			fmt.Printf("Unable to open sqlite database for HTTP API: %q\n", err)
+			os.Exit(1)
+		}
+		go func() {
+			fmt.Printf("Serving access_logs query API on %s\n", *httpAddr)
+			if err := runAPIServer(*httpAddr, apiDB, *apiToken); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("HTTP API server error: %q\n", err)
+			}
+		}()
+	}
+
+	if *follow {
+		fmt.Printf("Following %s, flushing every %d lines or %s\n", *logFile, *batchSize, *flushInterval)
+		if err := runFollow(*logFile, *sql_db, *batchSize, *flushInterval, format, version); err != nil {
+			fmt.Printf("Error following log file: %q\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Read and decode json line by line, add to logs slice
 	fmt.Printf("Parsing access logs from %s", *logFile)
-	logs, err := parseAccessLog(*logFile, *truncate)
+	logs, err := parseAccessLog(*logFile, *truncate, format, version)
 	if err != nil {
 		fmt.Printf("Unable to parse log file: %q\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Inserting logs to sql database")
-	err = insertLogs(logs, *sql_db)
+	sink, err := newSink(*sinkKind, *sql_db)
 	if err != nil {
-		fmt.Printf("Error inserting logs to database: %q\n", err)
+		fmt.Printf("Unable to set up %s sink: %q\n", *sinkKind, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Inserting logs to %s sink\n", *sinkKind)
+	if err := sink.Write(context.Background(), logs); err != nil {
+		fmt.Printf("Error writing logs to sink: %q\n", err)
+	}
+
+	if *httpAddr != "" {
+		select {} // keep serving the query API once ingestion is done
 	}
 }
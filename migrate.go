@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The sqlite schema is kept in sync with logEntry (and its BackendURL
+// sub-struct) automatically: accessLogColumns derives the access_logs columns
+// from logEntry's fields, and migration 2 below adds any that are missing. Any
+// field tagged as an HTTP header (request_*, downstream_*, origin_*) is
+// instead normalized into access_log_headers so new headers never require a
+// schema change.
+
+type columnSpec struct {
+	name    string
+	sqlType string
+}
+
+// isHeaderTag reports whether a logEntry json tag names a captured HTTP
+// header, per Traefik's request_*/downstream_*/origin_* convention.
+func isHeaderTag(tag string) bool {
+	return strings.HasPrefix(tag, "request_") || strings.HasPrefix(tag, "downstream_") || strings.HasPrefix(tag, "origin_")
+}
+
+func sqlTypeFor(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "INTEGER"
+	default:
+		return "TEXT"
+	}
+}
+
+// accessLogColumns derives the full set of access_logs columns from
+// logEntry's fields, flattening BackendURL and skipping header fields
+// (which live in access_log_headers instead).
+func accessLogColumns() []columnSpec {
+	var cols []columnSpec
+	backendURLType := reflect.TypeOf(backendTraefik{})
+	t := reflect.TypeOf(logEntry{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "" || isHeaderTag(tag) {
+			continue
+		}
+		if f.Type == backendURLType {
+			for j := 0; j < backendURLType.NumField(); j++ {
+				sub := backendURLType.Field(j)
+				cols = append(cols, columnSpec{name: f.Name + sub.Name, sqlType: sqlTypeFor(sub.Type.Kind())})
+			}
+			continue
+		}
+		cols = append(cols, columnSpec{name: f.Name, sqlType: sqlTypeFor(f.Type.Kind())})
+	}
+	return cols
+}
+
+// columnValues returns log's column values in the same order as
+// accessLogColumns, for use as INSERT bind parameters.
+func columnValues(log logEntry) []interface{} {
+	cols := accessLogColumns()
+	values := make([]interface{}, len(cols))
+	logVal := reflect.ValueOf(log)
+	backendVal := reflect.ValueOf(log.BackendURL)
+	for i, col := range cols {
+		if strings.HasPrefix(col.name, "BackendURL") {
+			values[i] = backendVal.FieldByName(strings.TrimPrefix(col.name, "BackendURL")).Interface()
+			continue
+		}
+		values[i] = logVal.FieldByName(col.name).Interface()
+	}
+	return values
+}
+
+type headerKV struct {
+	name  string
+	value string
+}
+
+// headerRows returns log's non-empty captured headers, keyed by their
+// original Traefik header tag (e.g. "request_User-Agent").
+func headerRows(log logEntry) []headerKV {
+	var rows []headerKV
+	v := reflect.ValueOf(log)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if !isHeaderTag(tag) {
+			continue
+		}
+		value := v.Field(i).String()
+		if value == "" {
+			continue
+		}
+		rows = append(rows, headerKV{name: tag, value: value})
+	}
+	return rows
+}
+
+func buildInsertSQL() string {
+	cols := accessLogColumns()
+	names := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+		placeholders[i] = "?"
+	}
+	return fmt.Sprintf("INSERT INTO access_logs (%s) VALUES (%s)", strings.Join(names, ", "), strings.Join(placeholders, ", "))
+}
+
+const insertHeaderSQL = `INSERT INTO access_log_headers (log_id, name, value) VALUES (?, ?, ?)`
+
+const createAccessLogHeadersTableSQL = `CREATE TABLE IF NOT EXISTS access_log_headers (
+	id INTEGER PRIMARY KEY,
+	log_id INTEGER NOT NULL REFERENCES access_logs(id),
+	name TEXT NOT NULL,
+	value TEXT NOT NULL
+)`
+
+const createSchemaMigrationsTableSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+)`
+
+// migration is one forward-only schema step. There is no down migration;
+// evolving the schema means appending a new migration, never editing one
+// that has shipped.
+type migration struct {
+	version int
+	name    string
+	apply   func(db *sql.DB) error
+}
+
+var migrations = []migration{
+	{1, "create_access_logs", func(db *sql.DB) error {
+		_, err := db.Exec(`CREATE TABLE IF NOT EXISTS access_logs (id INTEGER PRIMARY KEY)`)
+		return err
+	}},
+	{2, "sync_access_logs_columns", addMissingAccessLogColumns},
+	{3, "create_access_log_headers", func(db *sql.DB) error {
+		_, err := db.Exec(createAccessLogHeadersTableSQL)
+		return err
+	}},
+	// logEntry gained RequestScheme/TLSVersion/TLSCipher for Traefik v2
+	// support; addMissingAccessLogColumns is idempotent, so re-running it
+	// is the whole migration.
+	{4, "sync_access_logs_columns_v2", addMissingAccessLogColumns},
+}
+
+func addMissingAccessLogColumns(db *sql.DB) error {
+	existing, err := tableColumns(db, "access_logs")
+	if err != nil {
+		return err
+	}
+	for _, col := range accessLogColumns() {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE access_logs ADD COLUMN %s %s`, col.name, col.sqlType)); err != nil {
+			return fmt.Errorf("unable to add column %s: %q", col.name, err)
+		}
+	}
+	return nil
+}
+
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := map[string]bool{}
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+func appliedMigrationVersion(db *sql.DB) (int, error) {
+	var version int
+	row := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	if err := row.Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func recordMigration(db *sql.DB, m migration) error {
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	// PRAGMA doesn't accept bound parameters; m.version is our own int, never user input.
+	_, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version))
+	return err
+}
+
+// runMigrations brings db's schema up to date, applying any migrations
+// newer than its recorded version, in order.
+func runMigrations(db *sql.DB) error {
+	if _, err := db.Exec(createSchemaMigrationsTableSQL); err != nil {
+		return fmt.Errorf("unable to prepare schema_migrations table: %q", err)
+	}
+	current, err := appliedMigrationVersion(db)
+	if err != nil {
+		return fmt.Errorf("unable to read applied schema version: %q", err)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := m.apply(db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %q", m.version, m.name, err)
+		}
+		if err := recordMigration(db, m); err != nil {
+			return fmt.Errorf("unable to record migration %d (%s): %q", m.version, m.name, err)
+		}
+	}
+	return nil
+}
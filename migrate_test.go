@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestAccessLogColumnsFlattensBackendURLAndSkipsHeaders(t *testing.T) {
+	names := map[string]bool{}
+	for _, c := range accessLogColumns() {
+		names[c.name] = true
+	}
+	if !names["BackendURLHost"] {
+		t.Error("accessLogColumns should flatten BackendURL into columns like BackendURLHost")
+	}
+	if names["DownstreamContentType"] {
+		t.Error("accessLogColumns should skip header fields like DownstreamContentType (they live in access_log_headers)")
+	}
+}
+
+func TestColumnValuesMatchesAccessLogColumnsOrder(t *testing.T) {
+	log := logEntry{
+		BackendName: "my-backend",
+		BackendURL:  backendTraefik{Host: "backend.internal"},
+	}
+	cols := accessLogColumns()
+	values := columnValues(log)
+	if len(values) != len(cols) {
+		t.Fatalf("columnValues returned %d values, want %d (one per column)", len(values), len(cols))
+	}
+	for i, c := range cols {
+		switch c.name {
+		case "BackendURLHost":
+			if values[i] != "backend.internal" {
+				t.Errorf("BackendURLHost value = %v, want %q", values[i], "backend.internal")
+			}
+		case "BackendName":
+			if values[i] != "my-backend" {
+				t.Errorf("BackendName value = %v, want %q", values[i], "my-backend")
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// traefikVersion selects which Traefik JSON access-log shape a line of
+// input is expected to match.
+type traefikVersion int
+
+const (
+	traefikVersionAuto traefikVersion = iota
+	traefikVersionV1
+	traefikVersionV2
+)
+
+// parseTraefikVersion parses the --traefik_version flag value.
+func parseTraefikVersion(s string) (traefikVersion, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return traefikVersionAuto, nil
+	case "v1", "1":
+		return traefikVersionV1, nil
+	case "v2", "2":
+		return traefikVersionV2, nil
+	default:
+		return traefikVersionAuto, fmt.Errorf("unknown traefik_version %q, expected auto, v1, or v2", s)
+	}
+}
+
+// logEntryV2 mirrors the Traefik v2/v3 JSON access log shape: BackendName
+// and FrontendName were renamed to ServiceName and RouterName, the request
+// scheme and TLS metadata were added, and captured headers are lower-cased
+// after their request_/downstream_/origin_ prefix.
+type logEntryV2 struct {
+	BackendAddr                     int            `json:"BackendAddr"`
+	ServiceName                     string         `json:"ServiceName"`
+	BackendURL                      backendTraefik `json:"BackendURL"`
+	ClientAddr                      string         `json:"ClientAddr"`
+	ClientHost                      string         `json:"ClientHost"`
+	ClientPort                      string         `json:"ClientPort"`
+	ClientUsername                  string         `json:"ClientUsername"`
+	DownstreamContentSize           int            `json:"DownstreamContentSize"`
+	DownstreamStatus                int            `json:"DownstreamStatus"`
+	DownstreamStatusLine            string         `json:"DownstreamStatusLine"`
+	Duration                        int            `json:"Duration"`
+	RouterName                      string         `json:"RouterName"`
+	OriginContentSize               int            `json:"OriginContentSize"`
+	OriginDuration                  int            `json:"OriginDuration"`
+	OriginStatus                    int            `json:"OriginStatus"`
+	OriginStatusLine                string         `json:"OriginStatusLine"`
+	Overhead                        int            `json:"Overhead"`
+	RequestAddr                     string         `json:"RequestAddr"`
+	RequestContentSize              int            `json:"RequestContentSize"`
+	RequestCount                    int            `json:"RequestCount"`
+	RequestHost                     string         `json:"RequestHost"`
+	RequestLine                     string         `json:"RequestLine"`
+	RequestMethod                   string         `json:"RequestMethod"`
+	RequestPath                     string         `json:"RequestPath"`
+	RequestPort                     string         `json:"RequestPort"`
+	RequestProtocol                 string         `json:"RequestProtocol"`
+	RequestScheme                   string         `json:"RequestScheme"`
+	RetryAttempts                   int            `json:"RetryAttempts"`
+	StartLocal                      string         `json:"StartLocal"`
+	StartUTC                        string         `json:"StartUTC"`
+	TLSVersion                      string         `json:"TLSVersion"`
+	TLSCipher                       string         `json:"TLSCipher"`
+	DownstreamContentType           string         `json:"downstream_content-type"`
+	DownstreamDate                  string         `json:"downstream_date"`
+	Level                           string         `json:"level"`
+	Msg                             string         `json:"msg"`
+	OriginContentType               string         `json:"origin_content-type"`
+	OriginDate                      string         `json:"origin_date"`
+	RequestAccept                   string         `json:"request_accept"`
+	RequestAcceptEncoding           string         `json:"request_accept-encoding"`
+	RequestAcceptLanguage           string         `json:"request_accept-language"`
+	RequestAccessControlAllowOrigin string         `json:"request_access-control-allow-origin"`
+	RequestAuthorization            string         `json:"request_authorization"`
+	RequestDnt                      string         `json:"request_dnt"`
+	RequestReferer                  string         `json:"request_referer"`
+	RequestUserAgent                string         `json:"request_user-agent"`
+	Time                            string         `json:"time"`
+}
+
+// normalizeV2 maps a Traefik v2/v3 log line onto the canonical logEntry
+// shape the rest of the tool understands.
+func normalizeV2(raw logEntryV2) logEntry {
+	return logEntry{
+		BackendAddr:                     raw.BackendAddr,
+		BackendName:                     raw.ServiceName,
+		BackendURL:                      raw.BackendURL,
+		ClientAddr:                      raw.ClientAddr,
+		ClientHost:                      raw.ClientHost,
+		ClientPort:                      raw.ClientPort,
+		ClientUsername:                  raw.ClientUsername,
+		DownstreamContentSize:           raw.DownstreamContentSize,
+		DownstreamStatus:                raw.DownstreamStatus,
+		DownstreamStatusLine:            raw.DownstreamStatusLine,
+		Duration:                        raw.Duration,
+		FrontendName:                    raw.RouterName,
+		OriginContentSize:               raw.OriginContentSize,
+		OriginDuration:                  raw.OriginDuration,
+		OriginStatus:                    raw.OriginStatus,
+		OriginStatusLine:                raw.OriginStatusLine,
+		Overhead:                        raw.Overhead,
+		RequestAddr:                     raw.RequestAddr,
+		RequestContentSize:              raw.RequestContentSize,
+		RequestCount:                    raw.RequestCount,
+		RequestHost:                     raw.RequestHost,
+		RequestLine:                     raw.RequestLine,
+		RequestMethod:                   raw.RequestMethod,
+		RequestPath:                     raw.RequestPath,
+		RequestPort:                     raw.RequestPort,
+		RequestProtocol:                 raw.RequestProtocol,
+		RequestScheme:                   raw.RequestScheme,
+		RetryAttempts:                   raw.RetryAttempts,
+		StartLocal:                      raw.StartLocal,
+		StartUTC:                        raw.StartUTC,
+		TLSVersion:                      raw.TLSVersion,
+		TLSCipher:                       raw.TLSCipher,
+		DownstreamContentType:           raw.DownstreamContentType,
+		DownstreamDate:                  raw.DownstreamDate,
+		Level:                           raw.Level,
+		Msg:                             raw.Msg,
+		OriginContentType:               raw.OriginContentType,
+		OriginDate:                      raw.OriginDate,
+		RequestAccept:                   raw.RequestAccept,
+		RequestAcceptEncoding:           raw.RequestAcceptEncoding,
+		RequestAcceptLanguage:           raw.RequestAcceptLanguage,
+		RequestAccessControlAllowOrigin: raw.RequestAccessControlAllowOrigin,
+		RequestAuthorization:            raw.RequestAuthorization,
+		RequestDnt:                      raw.RequestDnt,
+		RequestReferer:                  raw.RequestReferer,
+		RequestUserAgent:                raw.RequestUserAgent,
+		Time:                            raw.Time,
+	}
+}
+
+// detectVersion sniffs a v2-only field to tell a v1 line from a v2 one.
+func detectVersion(line []byte) traefikVersion {
+	var probe struct {
+		RouterName   string `json:"RouterName"`
+		FrontendName string `json:"FrontendName"`
+	}
+	json.Unmarshal(line, &probe)
+	if probe.RouterName != "" {
+		return traefikVersionV2
+	}
+	return traefikVersionV1
+}
+
+// decodeLogLine decodes one JSON access-log line into the canonical
+// logEntry shape, selecting the v1 or v2 struct decoder per version (or by
+// sniffing the line when version is traefikVersionAuto).
+func decodeLogLine(line []byte, version traefikVersion) (logEntry, error) {
+	resolved := version
+	if resolved == traefikVersionAuto {
+		resolved = detectVersion(line)
+	}
+
+	if resolved == traefikVersionV2 {
+		var raw logEntryV2
+		if err := json.Unmarshal(line, &raw); err != nil {
+			return logEntry{}, err
+		}
+		return normalizeV2(raw), nil
+	}
+
+	var entry logEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return logEntry{}, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestParseTraefikVersion(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    traefikVersion
+		wantErr bool
+	}{
+		{"", traefikVersionAuto, false},
+		{"auto", traefikVersionAuto, false},
+		{"v1", traefikVersionV1, false},
+		{"1", traefikVersionV1, false},
+		{"v2", traefikVersionV2, false},
+		{"2", traefikVersionV2, false},
+		{"v3", traefikVersionAuto, true},
+	}
+	for _, c := range cases {
+		got, err := parseTraefikVersion(c.raw)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseTraefikVersion(%q) error = %v, wantErr %v", c.raw, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseTraefikVersion(%q) = %v, want %v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	if got := detectVersion([]byte(`{"RouterName":"web@docker"}`)); got != traefikVersionV2 {
+		t.Errorf("detectVersion(v2 line) = %v, want traefikVersionV2", got)
+	}
+	if got := detectVersion([]byte(`{"FrontendName":"web"}`)); got != traefikVersionV1 {
+		t.Errorf("detectVersion(v1 line) = %v, want traefikVersionV1", got)
+	}
+}
+
+func TestNormalizeV2MapsRenamedFields(t *testing.T) {
+	raw := logEntryV2{
+		ServiceName:      "my-service",
+		RouterName:       "my-router",
+		RequestScheme:    "https",
+		TLSVersion:       "1.3",
+		DownstreamStatus: 200,
+	}
+	entry := normalizeV2(raw)
+	if entry.BackendName != "my-service" {
+		t.Errorf("BackendName = %q, want %q", entry.BackendName, "my-service")
+	}
+	if entry.FrontendName != "my-router" {
+		t.Errorf("FrontendName = %q, want %q", entry.FrontendName, "my-router")
+	}
+	if entry.RequestScheme != "https" {
+		t.Errorf("RequestScheme = %q, want %q", entry.RequestScheme, "https")
+	}
+	if entry.TLSVersion != "1.3" {
+		t.Errorf("TLSVersion = %q, want %q", entry.TLSVersion, "1.3")
+	}
+	if entry.DownstreamStatus != 200 {
+		t.Errorf("DownstreamStatus = %d, want 200", entry.DownstreamStatus)
+	}
+}
+
+func TestDecodeLogLineSelectsVersionBySniffing(t *testing.T) {
+	v1Line := []byte(`{"FrontendName":"web","DownstreamStatus":200}`)
+	entry, err := decodeLogLine(v1Line, traefikVersionAuto)
+	if err != nil {
+		t.Fatalf("decodeLogLine(v1) returned error: %v", err)
+	}
+	if entry.FrontendName != "web" {
+		t.Errorf("FrontendName = %q, want %q", entry.FrontendName, "web")
+	}
+
+	v2Line := []byte(`{"RouterName":"web@docker","DownstreamStatus":200}`)
+	entry, err = decodeLogLine(v2Line, traefikVersionAuto)
+	if err != nil {
+		t.Fatalf("decodeLogLine(v2) returned error: %v", err)
+	}
+	if entry.FrontendName != "web@docker" {
+		t.Errorf("FrontendName = %q, want %q", entry.FrontendName, "web@docker")
+	}
+}
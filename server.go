@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiServer exposes access_logs over HTTP: an escape-hatch raw query
+// endpoint plus a couple of typed aggregate endpoints for common stats.
+type apiServer struct {
+	db    *sql.DB
+	token string
+}
+
+func newAPIServer(db *sql.DB, token string) *apiServer {
+	return &apiServer{db: db, token: token}
+}
+
+func (s *apiServer) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	return r.Header.Get("Authorization") == "Bearer "+s.token
+}
+
+func (s *apiServer) requireAuth(w http.ResponseWriter, r *http.Request) bool {
+	if s.authorized(r) {
+		return true
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// handleQuery runs a single read-only SELECT against access_logs, e.g.
+// /query?sql=SELECT+RequestHost,COUNT(*)+FROM+access_logs+GROUP+BY+RequestHost
+func (s *apiServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAuth(w, r) {
+		return
+	}
+	query := r.URL.Query().Get("sql")
+	if query == "" {
+		http.Error(w, "missing sql parameter", http.StatusBadRequest)
+		return
+	}
+	if !isReadOnlySelect(query) {
+		http.Error(w, "sql must be a single SELECT statement", http.StatusBadRequest)
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query failed: %q", err), http.StatusBadRequest)
+		return
+	}
+	defer rows.Close()
+	writeRows(w, rows)
+}
+
+// handleStatusCodes returns a count of requests per DownstreamStatus,
+// optionally restricted to StartUTC >= since.
+func (s *apiServer) handleStatusCodes(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAuth(w, r) {
+		return
+	}
+	query := `SELECT DownstreamStatus, COUNT(*) AS count FROM access_logs`
+	var args []interface{}
+	if since := r.URL.Query().Get("since"); since != "" {
+		query += ` WHERE StartUTC >= ?`
+		args = append(args, since)
+	}
+	query += ` GROUP BY DownstreamStatus ORDER BY DownstreamStatus`
+	rows, err := s.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query failed: %q", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	writeRows(w, rows)
+}
+
+// handleTopPaths returns the most frequently requested paths, capped at
+// limit (default 10).
+func (s *apiServer) handleTopPaths(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAuth(w, r) {
+		return
+	}
+	limit := 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	rows, err := s.db.QueryContext(r.Context(),
+		`SELECT RequestPath, COUNT(*) AS count FROM access_logs GROUP BY RequestPath ORDER BY count DESC LIMIT ?`, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query failed: %q", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	writeRows(w, rows)
+}
+
+// isReadOnlySelect reports whether query is a single SELECT statement, so
+// /query can't be used to mutate the database or run PRAGMAs/DDL despite
+// handing out raw SQL execution.
+func isReadOnlySelect(query string) bool {
+	trimmed := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if strings.ContainsRune(trimmed, ';') {
+		return false
+	}
+	return len(trimmed) >= 6 && strings.EqualFold(trimmed[:6], "select")
+}
+
+// writeRows drains rows into a JSON array of column-name -> value objects.
+func writeRows(w http.ResponseWriter, rows *sql.Rows) {
+	cols, err := rows.Columns()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to read columns: %q", err), http.StatusInternalServerError)
+		return
+	}
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			http.Error(w, fmt.Sprintf("unable to scan row: %q", err), http.StatusInternalServerError)
+			return
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			row[col] = values[i]
+		}
+		results = append(results, row)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// runAPIServer serves the query API on addr until it fails or is shut down.
+func runAPIServer(addr string, db *sql.DB, token string) error {
+	s := newAPIServer(db, token)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", s.handleQuery)
+	mux.HandleFunc("/stats/status_codes", s.handleStatusCodes)
+	mux.HandleFunc("/stats/top_paths", s.handleTopPaths)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsReadOnlySelect(t *testing.T) {
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM access_logs", true},
+		{"  select RequestPath from access_logs  ", true},
+		{"SELECT * FROM access_logs;", true},
+		{"SELECT * FROM access_logs; DROP TABLE access_logs", false},
+		{"DROP TABLE access_logs", false},
+		{"PRAGMA table_info(access_logs)", false},
+		{"DELETE FROM access_logs", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := isReadOnlySelect(c.query); got != c.want {
+			t.Errorf("isReadOnlySelect(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestAuthorizedRequiresMatchingBearerToken(t *testing.T) {
+	s := newAPIServer(nil, "secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	if s.authorized(req) {
+		t.Error("authorized(no header) = true, want false")
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if s.authorized(req) {
+		t.Error("authorized(wrong token) = true, want false")
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	if !s.authorized(req) {
+		t.Error("authorized(correct token) = false, want true")
+	}
+}
+
+func TestAuthorizedOpenWhenTokenEmpty(t *testing.T) {
+	s := newAPIServer(nil, "")
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	if !s.authorized(req) {
+		t.Error("authorized() with an empty server token = false, want true")
+	}
+}
+
+func TestHandleQueryRejectsUnauthorized(t *testing.T) {
+	s := newAPIServer(nil, "secret")
+	req := httptest.NewRequest(http.MethodGet, "/query?sql=SELECT+1", nil)
+	w := httptest.NewRecorder()
+
+	s.handleQuery(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandleQueryRejectsNonSelect(t *testing.T) {
+	s := newAPIServer(nil, "")
+	req := httptest.NewRequest(http.MethodGet, "/query?sql=DROP+TABLE+access_logs", nil)
+	w := httptest.NewRecorder()
+
+	s.handleQuery(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleQueryRejectsStackedStatements(t *testing.T) {
+	s := newAPIServer(nil, "")
+	req := httptest.NewRequest(http.MethodGet, "/query?sql=SELECT+1%3B+DROP+TABLE+access_logs", nil)
+	w := httptest.NewRecorder()
+
+	s.handleQuery(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
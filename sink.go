@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"os"
+	"strings"
+)
+
+// Sink writes a batch of parsed log entries to a destination.
+type Sink interface {
+	Write(ctx context.Context, logs []logEntry) error
+}
+
+// newSink builds the Sink named by kind. For mysql and postgres, dsn is
+// passed straight through to database/sql as the driver-specific connection
+// string; for sqlite it is a file path, to which openSQLiteDB appends its
+// busy-timeout and WAL parameters.
+func newSink(kind, dsn string) (Sink, error) {
+	switch kind {
+	case "", "sqlite", "sqlite3":
+		return newSQLSink("sqlite3", dsn)
+	case "mysql":
+		return newSQLSink("mysql", dsn)
+	case "postgres":
+		return newSQLSink("postgres", dsn)
+	case "stdout":
+		return newStdoutSink(), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q, expected sqlite, mysql, postgres, or stdout", kind)
+	}
+}
+
+// isSQLiteSink reports whether kind names the sqlite sink, the only sink the
+// HTTP query API (server.go) knows how to read from.
+func isSQLiteSink(kind string) bool {
+	switch kind {
+	case "", "sqlite", "sqlite3":
+		return true
+	default:
+		return false
+	}
+}
+
+// openSQLiteDB opens the sqlite database at path with pragmas tuned for a
+// file that --follow's ingest connection and the --http_addr query API may
+// both have open at once: a busy timeout so a writer and reader contending
+// for the same page retry instead of failing with "database is locked", and
+// WAL mode so readers don't block the writer in the first place.
+//
+// Both are set via DSN query parameters rather than a PRAGMA db.Exec: Go's
+// database/sql pools multiple underlying sqlite connections, busy_timeout is
+// per-connection (unlike journal_mode, which is persisted in the file
+// header), and an Exec against the pool has no guarantee of reaching every
+// connection sql.DB later hands out.
+func openSQLiteDB(path string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := path + sep + "_busy_timeout=5000&_journal_mode=WAL"
+	return sql.Open("sqlite3", dsn)
+}
+
+// sqlSink writes logs to any database/sql driver, preparing the insert
+// statement once per batch inside a single transaction.
+type sqlSink struct {
+	db     *sql.DB
+	driver string
+}
+
+func newSQLSink(driver, dsn string) (*sqlSink, error) {
+	var db *sql.DB
+	var err error
+	if driver == "sqlite3" {
+		db, err = openSQLiteDB(dsn)
+	} else {
+		db, err = sql.Open(driver, dsn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s database: %q", driver, err)
+	}
+	// The full, auto-migrating schema (migrate.go) is sqlite-specific: it
+	// leans on PRAGMA table_info/user_version. mysql and postgres keep the
+	// original fixed column set.
+	if driver == "sqlite3" {
+		err = runMigrations(db)
+	} else {
+		_, err = db.Exec(createAccessLogsTableSQLFor(driver))
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to prepare access_logs table: %q", err)
+	}
+	return &sqlSink{db: db, driver: driver}, nil
+}
+
+func (s *sqlSink) Write(ctx context.Context, logs []logEntry) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if s.driver == "sqlite3" {
+		return writeFullSchema(ctx, s.db, logs)
+	}
+	return writeSlimSchema(ctx, s.db, s.driver, logs)
+}
+
+// writeFullSchema inserts every access_logs column plus each log's
+// non-empty headers into access_log_headers, in one transaction.
+func writeFullSchema(ctx context.Context, db *sql.DB, logs []logEntry) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %q", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, buildInsertSQL())
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to prepare SQL statement: %q", err)
+	}
+	defer stmt.Close()
+	headerStmt, err := tx.PrepareContext(ctx, insertHeaderSQL)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to prepare header SQL statement: %q", err)
+	}
+	defer headerStmt.Close()
+
+	for _, log := range logs {
+		res, err := stmt.ExecContext(ctx, columnValues(log)...)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to insert log line: %q", err)
+		}
+		logID, err := res.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to read inserted log id: %q", err)
+		}
+		for _, h := range headerRows(log) {
+			if _, err := headerStmt.ExecContext(ctx, logID, h.name, h.value); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("unable to insert header %s: %q", h.name, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// writeSlimSchema inserts the fixed, pre-chunk0-3 column set used by the
+// mysql and postgres sinks.
+func writeSlimSchema(ctx context.Context, db *sql.DB, driver string, logs []logEntry) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %q", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, insertAccessLogSQLFor(driver))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to prepare SQL statement: %q", err)
+	}
+	defer stmt.Close()
+	for _, log := range logs {
+		if _, err := stmt.ExecContext(ctx, log.BackendName, log.BackendURL.Scheme, log.BackendURL.Host, log.ClientAddr, log.ClientHost, log.ClientPort,
+			log.ClientUsername, log.DownstreamStatus, log.DownstreamContentSize, log.Duration, log.FrontendName, log.OriginContentSize, log.OriginDuration,
+			log.RequestAddr, log.RequestContentSize, log.RequestCount, log.RequestHost, log.RequestMethod, log.RequestPath, log.RequestPort,
+			log.RequestProtocol, log.StartUTC, log.RequestReferer, log.RequestUserAgent, log.Time); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to insert log line: %q", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// stdoutSink writes each log entry as a line of JSON to stdout, for piping
+// into other tooling without a database in the loop.
+type stdoutSink struct {
+	enc *json.Encoder
+}
+
+func newStdoutSink() *stdoutSink {
+	return &stdoutSink{enc: json.NewEncoder(os.Stdout)}
+}
+
+func (s *stdoutSink) Write(ctx context.Context, logs []logEntry) error {
+	for _, log := range logs {
+		if err := s.enc.Encode(log); err != nil {
+			return fmt.Errorf("unable to write log line to stdout: %q", err)
+		}
+	}
+	return nil
+}
+
+func createAccessLogsTableSQLFor(driver string) string {
+	if driver == "postgres" {
+		return createAccessLogsTableSQLPostgres
+	}
+	return createAccessLogsTableSQLMySQL
+}
+
+func insertAccessLogSQLFor(driver string) string {
+	if driver == "postgres" {
+		return insertAccessLogSQLPostgres
+	}
+	return insertAccessLogSQLMySQL
+}
+
+const createAccessLogsTableSQLMySQL = `CREATE TABLE IF NOT EXISTS access_logs (id INTEGER PRIMARY KEY AUTO_INCREMENT, BackendName TEXT, BackendURLScheme TEXT,
+	BackendURLHost TEXT, ClientAddr TEXT, ClientHost TEXT, ClientPort TEXT, ClientUsername TEXT, DownstreamStatus INTEGER, DownstreamContentSize INTEGER,
+	Duration INTEGER, FrontendName TEXT, OriginContentSize INTEGER, OriginDuration INTEGER, RequestAddr TEXT, RequestContentSize INTEGER,
+	RequestCount INTEGER, RequestHost TEXT, RequestMethod TEXT, RequestPath TEXT, RequestPort TEXT, RequestProtocol TEXT, StartUTC TEXT, RequestReferer TEXT,
+	RequestUserAgent TEXT, Time TEXT)`
+
+const createAccessLogsTableSQLPostgres = `CREATE TABLE IF NOT EXISTS access_logs (id SERIAL PRIMARY KEY, BackendName TEXT, BackendURLScheme TEXT,
+	BackendURLHost TEXT, ClientAddr TEXT, ClientHost TEXT, ClientPort TEXT, ClientUsername TEXT, DownstreamStatus INTEGER, DownstreamContentSize INTEGER,
+	Duration INTEGER, FrontendName TEXT, OriginContentSize INTEGER, OriginDuration INTEGER, RequestAddr TEXT, RequestContentSize INTEGER,
+	RequestCount INTEGER, RequestHost TEXT, RequestMethod TEXT, RequestPath TEXT, RequestPort TEXT, RequestProtocol TEXT, StartUTC TEXT, RequestReferer TEXT,
+	RequestUserAgent TEXT, Time TEXT)`
+
+const insertAccessLogSQLMySQL = `INSERT INTO access_logs (BackendName, BackendURLScheme, BackendURLHost, ClientAddr, ClientHost, ClientPort,
+	ClientUsername, DownstreamStatus, DownstreamContentSize, Duration, FrontendName, OriginContentSize, OriginDuration, RequestAddr, RequestContentSize,
+	RequestCount, RequestHost, RequestMethod, RequestPath, RequestPort, RequestProtocol, StartUTC, RequestReferer, RequestUserAgent, Time) VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+const insertAccessLogSQLPostgres = `INSERT INTO access_logs (BackendName, BackendURLScheme, BackendURLHost, ClientAddr, ClientHost, ClientPort,
+	ClientUsername, DownstreamStatus, DownstreamContentSize, Duration, FrontendName, OriginContentSize, OriginDuration, RequestAddr, RequestContentSize,
+	RequestCount, RequestHost, RequestMethod, RequestPath, RequestPort, RequestProtocol, StartUTC, RequestReferer, RequestUserAgent, Time) VALUES
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)`